@@ -3,25 +3,30 @@ package main
 import (
 	"bytes"
 	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/fadend/go-photos/cache"
+	"github.com/fadend/go-photos/media"
+	"github.com/fadend/go-photos/store"
 	"github.com/nfnt/resize"
-	"github.com/rwcarlsen/goexif/exif"
 	"html/template"
+	"image"
 	"image/jpeg"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-const (
-	MaxThumbnailWidth  = 300
-	MaxThumbnailHeight = 400
-	UnknownDateString  = "???"
-)
+const UnknownDateString = "???"
 
 var HeadTemplate *template.Template = template.Must(template.New("head").Parse(`<!DOCTYPE html>
 <html lang='en'>
@@ -39,12 +44,38 @@ var HeadTemplate *template.Template = template.Must(template.New("head").Parse(`
 <p>{{.NumImages}} images in this album and subalbums.</p>`))
 
 var SubAlbumTemplate *template.Template = template.Must(template.New("subalbum").Parse(`
-<a href="{{.Name}}/index.html">{{.Name}}</a> ({{.NumImages}} images, {{.DateRangeString}})`))
+<a href="{{.Name}}/index.html">{{.Name}}</a> ({{.NumImages}} images, {{.DateRangeString}}{{if .HasGPS}}, {{.GeoRangeString}}{{end}})`))
+
+var ImgTemplate *template.Template = template.Must(template.New("img").Parse(`<a class="img-link" id="{{.AnchorID}}" href="{{.Name}}">
+  <img src="{{.LargestThumbnail.Name}}" srcset="{{.SrcSet}}" sizes="{{.Sizes}}" loading="lazy"
+    alt="{{.Name}}" title="{{.TimeString}} {{.Name}}"
+    width="{{.LargestThumbnail.Width}}" height="{{.LargestThumbnail.Height}}">
+</a>{{if .Rotated}}<span title="Rotated based on EXIF orientation">&#8635;</span>{{end}}`))
 
-var ImgTemplate *template.Template = template.Must(template.New("img").Parse(`<a class="img-link" href="{{.Name}}">
-  <img src="{{.Thumbnail.Name}}" alt="{{.Name}}" title="{{.TimeString}} {{.Name}}"
-    width="{{.Thumbnail.Width}}" height="{{.Thumbnail.Height}}">
-</a>`))
+// MapTemplate renders a Leaflet map with a marker for each image in .
+// Markers link to the image's anchor in the thumbnail grid below. It should
+// only be executed when at least one image has GPS data.
+var MapTemplate *template.Template = template.Must(template.New("map").Parse(`
+<div id="album-map" style="height: 400px; margin-bottom: 1em;"></div>
+<link rel="stylesheet" href="https://unpkg.com/leaflet@1.9.4/dist/leaflet.css">
+<script src="https://unpkg.com/leaflet@1.9.4/dist/leaflet.js"></script>
+<script>
+(function() {
+  var markers = [
+{{range .}}    {lat: {{.Lat}}, lon: {{.Lon}}, name: "{{.Name}}", anchor: "{{.AnchorID}}"},
+{{end}}  ];
+  var map = L.map('album-map');
+  L.tileLayer('https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png', {
+    attribution: '&copy; OpenStreetMap contributors'
+  }).addTo(map);
+  var bounds = [];
+  markers.forEach(function(m) {
+    L.marker([m.lat, m.lon]).addTo(map).bindPopup('<a href="#' + m.anchor + '">' + m.name + '</a>');
+    bounds.push([m.lat, m.lon]);
+  });
+  map.fitBounds(bounds);
+})();
+</script>`))
 
 // Time after all likely user photo times.
 // Using the value from https://stackoverflow.com/a/32620397.
@@ -56,8 +87,45 @@ var FutureTime = time.Unix(1<<63-62135596801, 999999999)
 // (January 1, year 1, 00:00:00.000000000 UTC).
 var PastTime = time.Time{}
 
+// Starting values for an album's GPS bounding box, chosen so that the first
+// real coordinate seen always expands them.
+const (
+	StartMinLat = 90.0
+	StartMaxLat = -90.0
+	StartMinLon = 180.0
+	StartMaxLon = -180.0
+)
+
 var inputDirFlag = flag.String("input", "", "Path to input photos directory.")
 var outputDirFlag = flag.String("output", "", "Path at which to write album.")
+var contentStoreFlag = flag.Bool("content-store", false,
+	"If set, maintain a content-addressed store and by-date tree under the output dir, "+
+		"hardlinking albums into them and skipping re-processing of already-seen files.")
+var forceFlag = flag.Bool("force", false,
+	"If set, reprocess every image even if the per-directory album.json cache says it's unchanged.")
+var jobsFlag = flag.Int("jobs", runtime.NumCPU(),
+	"Number of images to process concurrently.")
+var thumbnailWidthsFlag = flag.String("thumbnail-widths", "300,600,1200",
+	"Comma-separated list of thumbnail widths, in pixels, to generate, smallest first.")
+
+// parseThumbnailWidths parses a comma-separated list of pixel widths (e.g.
+// "300,600,1200") into a slice of ints sorted increasing.
+func parseThumbnailWidths(csv string) ([]int, error) {
+	parts := strings.Split(csv, ",")
+	widths := make([]int, 0, len(parts))
+	for _, part := range parts {
+		width, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid width %q: %w", part, err)
+		}
+		if width <= 0 {
+			return nil, fmt.Errorf("width must be positive: %d", width)
+		}
+		widths = append(widths, width)
+	}
+	slices.Sort(widths)
+	return widths, nil
+}
 
 type Thumbnail struct {
 	Name   string
@@ -66,9 +134,56 @@ type Thumbnail struct {
 }
 
 type Image struct {
-	Name      string
-	Thumbnail Thumbnail
-	DateTime  time.Time
+	Name        string
+	Thumbnails  []Thumbnail
+	DateTime    time.Time
+	Hash        string
+	Orientation int
+	Lat         float64
+	Lon         float64
+	HasGPS      bool
+}
+
+// Rotated reports whether this image's EXIF orientation required rotating or
+// flipping it before display, so templates can show an indicator.
+func (i Image) Rotated() bool {
+	return i.Orientation > 1
+}
+
+// AnchorID returns the id attribute used for this image's link, so the map's
+// markers can jump to it.
+func (i Image) AnchorID() string {
+	return "img-" + i.Name
+}
+
+// LargestThumbnail returns the biggest generated thumbnail, used for the
+// <img> tag's src/width/height fallback; smaller sizes are offered via
+// SrcSet for the browser to pick from instead.
+func (i Image) LargestThumbnail() Thumbnail {
+	return i.Thumbnails[len(i.Thumbnails)-1]
+}
+
+// SrcSet builds the srcset attribute value listing every generated
+// thumbnail width.
+func (i Image) SrcSet() string {
+	parts := make([]string, len(i.Thumbnails))
+	for idx, t := range i.Thumbnails {
+		parts[idx] = fmt.Sprintf("%s %dw", t.Name, t.Width)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Sizes builds a sizes attribute that asks the browser to use each
+// thumbnail width up to its own width, falling back to the largest
+// thumbnail beyond that.
+func (i Image) Sizes() string {
+	thumbnails := i.Thumbnails
+	parts := make([]string, 0, len(thumbnails))
+	for _, t := range thumbnails[:len(thumbnails)-1] {
+		parts = append(parts, fmt.Sprintf("(max-width: %dpx) %dpx", t.Width, t.Width))
+	}
+	parts = append(parts, fmt.Sprintf("%dpx", thumbnails[len(thumbnails)-1].Width))
+	return strings.Join(parts, ", ")
 }
 
 type Album struct {
@@ -76,6 +191,11 @@ type Album struct {
 	NumImages int
 	MinTime   time.Time
 	MaxTime   time.Time
+	HasGPS    bool
+	MinLat    float64
+	MaxLat    float64
+	MinLon    float64
+	MaxLon    float64
 }
 
 func timeToString(t time.Time) string {
@@ -112,87 +232,438 @@ func (a Album) DateRangeString() string {
 	return minStr
 }
 
-func isImageFile(path string) bool {
-	return strings.HasSuffix(path, "jpeg") || strings.HasSuffix(path, "jpg")
+// GeoRangeString describes a's GPS bounding box, for display next to its
+// date range. Callers should check HasGPS first.
+func (a Album) GeoRangeString() string {
+	return fmt.Sprintf("lat %.4f to %.4f, lon %.4f to %.4f", a.MinLat, a.MaxLat, a.MinLon, a.MaxLon)
 }
 
-// readEXIFDate extracts the date from the EXIF metadata from the given file.
-func readEXIFDateTime(imageBytes []byte) (time.Time, error) {
-	x, err := exif.Decode(bytes.NewReader(imageBytes))
-	if err != nil {
-		return time.Time{}, err
+// expandBounds grows a's GPS bounding box, if needed, to include (lat, lon).
+func (a *Album) expandBounds(lat, lon float64) {
+	if lat < a.MinLat {
+		a.MinLat = lat
+	}
+	if lat > a.MaxLat {
+		a.MaxLat = lat
+	}
+	if lon < a.MinLon {
+		a.MinLon = lon
+	}
+	if lon > a.MaxLon {
+		a.MaxLon = lon
 	}
-	return x.DateTime()
 }
 
-// createThumbnail makes a thumbnail file for the given image in outputDir.
-// It returns the base filename (e.g., "pic_thumbnail.jpeg") for the new file in outputDir.
-func createThumbnail(imageBytes []byte, imageName string, outputDir string) (Thumbnail, error) {
+func isImageFile(path string) bool {
+	return media.IsRegistered(path)
+}
+
+// thumbnailSuffix returns the filename suffix (including extension) used for
+// a thumbnail of the given width. Thumbnails are always normalized to JPEG,
+// regardless of the source format.
+func thumbnailSuffix(width int) string {
+	return fmt.Sprintf("_w%d.jpg", width)
+}
+
+// thumbnailNameFor returns the filename of the width-pixel-wide thumbnail for imageName.
+func thumbnailNameFor(imageName string, width int) string {
 	dot := strings.LastIndexByte(imageName, '.')
 	// This should be impossible; just die.
 	if dot == -1 {
 		log.Fatalf("imageName missing extension: %s", imageName)
 	}
-	thumbnailName := imageName[:dot] + "_thumbnail" + imageName[dot:]
-	image, err := jpeg.Decode(bytes.NewReader(imageBytes))
+	return imageName[:dot] + thumbnailSuffix(width)
+}
+
+// thumbnailBounds reads the pixel dimensions of an already-written thumbnail file.
+func thumbnailBounds(path string) (image.Rectangle, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return Thumbnail{}, err
+		return image.Rectangle{}, err
 	}
-	thumbnail := resize.Thumbnail(MaxThumbnailWidth, MaxThumbnailHeight, image, resize.Lanczos3)
-	out, err := os.Create(filepath.Join(outputDir, thumbnailName))
+	defer f.Close()
+	cfg, err := jpeg.DecodeConfig(f)
 	if err != nil {
-		return Thumbnail{}, err
+		return image.Rectangle{}, err
 	}
-	// Ignoring the advice here for now: https://www.joeshaw.org/dont-defer-close-on-writable-files/
-	defer out.Close()
-	if err := jpeg.Encode(out, thumbnail, nil); err != nil {
-		return Thumbnail{}, err
+	return image.Rect(0, 0, cfg.Width, cfg.Height), nil
+}
+
+// createThumbnails makes one thumbnail file per width in outputDir from an
+// already-decoded (and already EXIF-oriented) image, skipping any width
+// whose file already exists on disk at that width. Returned thumbnails are
+// in the same order as widths.
+func createThumbnails(img image.Image, imageName string, outputDir string, widths []int) ([]Thumbnail, error) {
+	thumbnails := make([]Thumbnail, 0, len(widths))
+	for _, width := range widths {
+		name := thumbnailNameFor(imageName, width)
+		path := filepath.Join(outputDir, name)
+		if bounds, err := thumbnailBounds(path); err == nil && bounds.Dx() == width {
+			thumbnails = append(thumbnails, Thumbnail{Name: name, Width: bounds.Dx(), Height: bounds.Dy()})
+			continue
+		}
+		resized := resize.Resize(uint(width), 0, img, resize.Lanczos3)
+		out, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		// Ignoring the advice here for now: https://www.joeshaw.org/dont-defer-close-on-writable-files/
+		err = jpeg.Encode(out, resized, nil)
+		out.Close()
+		if err != nil {
+			return nil, err
+		}
+		bounds := resized.Bounds()
+		thumbnails = append(thumbnails, Thumbnail{Name: name, Width: bounds.Dx(), Height: bounds.Dy()})
 	}
-	bounds := thumbnail.Bounds()
-	return Thumbnail{Name: thumbnailName, Width: bounds.Dx(), Height: bounds.Dy()}, nil
+	return thumbnails, nil
 }
 
-// processImage generates a thumbnail, extracts EXIF info, and copies the original to outputDir.
-func processImage(inputDir string, imageName string, outputDir string, ch chan Image) {
-	result := Image{Name: imageName}
+// contentStore bundles the on-disk content-addressed/by-date trees with the
+// manifest tracking what's in them. A nil *contentStore means the feature is
+// disabled and processImage should behave as before.
+type contentStore struct {
+	root     string
+	manifest *store.Manifest
+}
+
+// linkFrom hardlinks the already-processed original and every thumbnail
+// width for hash out of the store into outputDir, returning true if they
+// were all found there.
+func (cs *contentStore) linkFrom(hash, ext, imageName string, widths []int, outputDir string) bool {
+	contentPath := store.ContentPath(cs.root, hash, ext)
+	if _, err := os.Stat(contentPath); err != nil {
+		return false
+	}
+	for _, width := range widths {
+		if _, err := os.Stat(store.ContentPath(cs.root, hash, thumbnailSuffix(width))); err != nil {
+			return false
+		}
+	}
+	if err := store.LinkOrCopy(contentPath, filepath.Join(outputDir, imageName)); err != nil {
+		log.Printf("Problem linking %s from content store: %+v", imageName, err)
+		return false
+	}
+	for _, width := range widths {
+		thumbnailContentPath := store.ContentPath(cs.root, hash, thumbnailSuffix(width))
+		thumbnailName := thumbnailNameFor(imageName, width)
+		if err := store.LinkOrCopy(thumbnailContentPath, filepath.Join(outputDir, thumbnailName)); err != nil {
+			log.Printf("Problem linking thumbnail for %s from content store: %+v", imageName, err)
+			return false
+		}
+	}
+	return true
+}
+
+// add hardlinks the original and every thumbnail width just written to
+// outputDir into the content-addressed and by-date trees, and records
+// originalPath in the manifest.
+func (cs *contentStore) add(hash, ext, imageName string, widths []int, outputDir, originalPath string, dateTime time.Time) {
+	original := filepath.Join(outputDir, imageName)
+	if err := store.LinkOrCopy(original, store.ContentPath(cs.root, hash, ext)); err != nil {
+		log.Printf("Problem adding %s to content store: %+v", imageName, err)
+	}
+	for _, width := range widths {
+		thumbnail := filepath.Join(outputDir, thumbnailNameFor(imageName, width))
+		if err := store.LinkOrCopy(thumbnail, store.ContentPath(cs.root, hash, thumbnailSuffix(width))); err != nil {
+			log.Printf("Problem adding thumbnail for %s to content store: %+v", imageName, err)
+		}
+	}
+	if !dateTime.IsZero() {
+		if err := store.LinkOrCopy(original, store.DatePath(cs.root, dateTime, ext)); err != nil {
+			log.Printf("Problem adding %s to date store: %+v", imageName, err)
+		}
+	}
+	cs.manifest.Add(hash, originalPath)
+}
+
+// imageFromEntry reconstructs the Image metadata recorded in a cache.Entry,
+// for a file whose thumbnails and full-size copy are assumed to still be
+// sitting untouched in outputDir from a previous run.
+func imageFromEntry(e cache.Entry) Image {
+	thumbnails := make([]Thumbnail, len(e.Thumbnails))
+	for i, t := range e.Thumbnails {
+		thumbnails[i] = Thumbnail{Name: thumbnailNameFor(e.Name, t.Width), Width: t.Width, Height: t.Height}
+	}
+	return Image{
+		Name:        e.Name,
+		Thumbnails:  thumbnails,
+		DateTime:    e.EXIFDateTime,
+		Hash:        e.SHA256,
+		Orientation: e.Orientation,
+		Lat:         e.Lat,
+		Lon:         e.Lon,
+		HasGPS:      e.HasGPS,
+	}
+}
+
+// reconcileThumbnails reconciles a cached image's thumbnails against the
+// currently-requested widths: it reuses thumbnails that are still wanted,
+// removes thumbnail files for widths that aren't requested any more, and
+// decodes the full-size copy already sitting in outputDir (from whatever
+// earlier run produced it) to generate any newly-requested width that's
+// missing. Returned thumbnails are in the same order as widths.
+func reconcileThumbnails(outputDir string, imageName string, widths []int, cached []Thumbnail) ([]Thumbnail, error) {
+	byWidth := make(map[int]Thumbnail, len(cached))
+	for _, t := range cached {
+		byWidth[t.Width] = t
+	}
+	want := make(map[int]bool, len(widths))
+	for _, width := range widths {
+		want[width] = true
+	}
+	for width, t := range byWidth {
+		if want[width] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(outputDir, t.Name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Problem removing unwanted thumbnail %s: %+v", t.Name, err)
+		}
+		delete(byWidth, width)
+	}
+	var missing []int
+	for _, width := range widths {
+		if _, ok := byWidth[width]; !ok {
+			missing = append(missing, width)
+		}
+	}
+	if len(missing) > 0 {
+		decoder, ok := media.ForPath(imageName)
+		if !ok {
+			return nil, fmt.Errorf("no media decoder registered for %s", imageName)
+		}
+		copyPath := filepath.Join(outputDir, imageName)
+		copyBytes, err := os.ReadFile(copyPath)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read existing copy %s: %w", copyPath, err)
+		}
+		decoded, err := decoder.DecodeImage(copyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode existing copy %s: %w", copyPath, err)
+		}
+		newThumbnails, err := createThumbnails(decoded, imageName, outputDir, missing)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create missing thumbnails for %s: %w", imageName, err)
+		}
+		for _, t := range newThumbnails {
+			byWidth[t.Width] = t
+		}
+	}
+	thumbnails := make([]Thumbnail, len(widths))
+	for i, width := range widths {
+		thumbnails[i] = byWidth[width]
+	}
+	return thumbnails, nil
+}
+
+// reconcileCachedEntry turns a cache.Entry into an Image, reconciling its
+// thumbnails against widths. It reports ok=false (with no error) when entry
+// predates the multi-width thumbnail schema (no Thumbnails recorded at all),
+// so callers should treat that as a cache miss and reprocess from scratch.
+func reconcileCachedEntry(entry cache.Entry, outputDir string, widths []int) (img Image, ok bool, err error) {
+	if len(entry.Thumbnails) == 0 {
+		return Image{}, false, nil
+	}
+	img = imageFromEntry(entry)
+	thumbnails, err := reconcileThumbnails(outputDir, entry.Name, widths, img.Thumbnails)
+	if err != nil {
+		return Image{}, false, err
+	}
+	img.Thumbnails = thumbnails
+	return img, true, nil
+}
+
+// processImage generates thumbnails, extracts a capture time, and copies the original to outputDir.
+// If cs is non-nil, it dedupes against (and populates) its content-addressed store. If manifest is
+// non-nil, it skips redoing this work when manifest says the file hasn't changed since the last run,
+// unless force is set. Errors are returned rather than killing the process, so that one bad file
+// doesn't take down a whole worker pool.
+func processImage(inputDir string, imageName string, outputDir string, cs *contentStore, manifest *cache.Manifest, force bool, widths []int) (Image, error) {
 	imagePath := filepath.Join(inputDir, imageName)
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return Image{}, fmt.Errorf("couldn't stat image %s: %w", imagePath, err)
+	}
+
+	if manifest != nil && !force {
+		if entry, ok := manifest.Get(imageName); ok && entry.Matches(info) {
+			img, ok, err := reconcileCachedEntry(entry, outputDir, widths)
+			if err != nil {
+				return Image{}, fmt.Errorf("couldn't reconcile cached thumbnails for %s: %w", imagePath, err)
+			}
+			if ok {
+				manifest.Set(entryFor(img, info))
+				return img, nil
+			}
+			// entry predates the multi-width thumbnail schema; fall through
+			// and reprocess this image from scratch.
+		}
+	}
+
+	result := Image{Name: imageName}
 	imageBytes, err := os.ReadFile(imagePath)
 	if err != nil {
-		fmt.Printf("Couldn't read image %s: %+v", imagePath, err)
-		os.Exit(1)
+		return Image{}, fmt.Errorf("couldn't read image %s: %w", imagePath, err)
+	}
+	sum := sha256.Sum256(imageBytes)
+	result.Hash = hex.EncodeToString(sum[:])
+
+	if manifest != nil && !force {
+		if entry, ok := manifest.Get(imageName); ok && entry.SHA256 == result.Hash {
+			// Safe path: content is unchanged even though size/mtime moved
+			// (e.g. touched or re-copied).
+			img, ok, err := reconcileCachedEntry(entry, outputDir, widths)
+			if err != nil {
+				return Image{}, fmt.Errorf("couldn't reconcile cached thumbnails for %s: %w", imagePath, err)
+			}
+			if ok {
+				manifest.Set(entryFor(img, info))
+				return img, nil
+			}
+			// entry predates the multi-width thumbnail schema; fall through
+			// and reprocess this image from scratch.
+		}
 	}
-	if t, err := readEXIFDateTime(imageBytes); err == nil {
+
+	decoder, ok := media.ForPath(imageName)
+	if !ok {
+		return Image{}, fmt.Errorf("no media decoder registered for %s", imageName)
+	}
+	if t, err := decoder.Timestamp(imageBytes, info); err == nil {
 		result.DateTime = t
 	} else {
-		log.Printf("Problem reading EXIF date-time for %s: %+v", imagePath, err)
+		log.Printf("Problem reading timestamp for %s: %+v", imagePath, err)
 	}
-	if thumbnail, err := createThumbnail(imageBytes, imageName, outputDir); err == nil {
-		result.Thumbnail = thumbnail
-	} else {
-		fmt.Printf("Couldn't create thumbnail for image %s: %+v", imagePath, err)
-		os.Exit(1)
+	result.Orientation = 1
+	if op, ok := decoder.(media.OrientationProvider); ok {
+		if o, err := op.Orientation(imageBytes); err == nil {
+			result.Orientation = o
+		}
+	}
+	if gp, ok := decoder.(media.GPSProvider); ok {
+		if lat, lon, err := gp.LatLong(imageBytes); err == nil {
+			result.Lat, result.Lon, result.HasGPS = lat, lon, true
+		}
+	}
+
+	dot := strings.LastIndexByte(imageName, '.')
+	if dot == -1 {
+		return Image{}, fmt.Errorf("imageName missing extension: %s", imageName)
+	}
+	ext := imageName[dot:]
+
+	if cs != nil && cs.linkFrom(result.Hash, ext, imageName, widths, outputDir) {
+		thumbnails := make([]Thumbnail, 0, len(widths))
+		for _, width := range widths {
+			name := thumbnailNameFor(imageName, width)
+			bounds, err := thumbnailBounds(filepath.Join(outputDir, name))
+			if err != nil {
+				return Image{}, fmt.Errorf("couldn't read linked thumbnail for %s: %w", imagePath, err)
+			}
+			thumbnails = append(thumbnails, Thumbnail{Name: name, Width: bounds.Dx(), Height: bounds.Dy()})
+		}
+		result.Thumbnails = thumbnails
+		cs.manifest.Add(result.Hash, imagePath)
+		if manifest != nil {
+			manifest.Set(entryFor(result, info))
+		}
+		return result, nil
+	}
+
+	decoded, err := decoder.DecodeImage(imageBytes)
+	if err != nil {
+		return Image{}, fmt.Errorf("couldn't decode image %s: %w", imagePath, err)
+	}
+	oriented := applyOrientation(decoded, result.Orientation)
+
+	thumbnails, err := createThumbnails(oriented, imageName, outputDir, widths)
+	if err != nil {
+		return Image{}, fmt.Errorf("couldn't create thumbnails for image %s: %w", imagePath, err)
 	}
-	// Finally, copy the full size image to the new location.
+	result.Thumbnails = thumbnails
+
+	// Copy the full size image to the new location, re-encoding as JPEG only
+	// if it needed rotating/flipping so that browsers that ignore EXIF
+	// orientation still display it correctly.
 	copyName := filepath.Join(outputDir, imageName)
-	if err := os.WriteFile(copyName, imageBytes, 0750); err != nil {
-		fmt.Printf("Couldn't create copy %s: %+v", copyName, err)
-		os.Exit(1)
+	if result.Orientation > 1 {
+		out, err := os.Create(copyName)
+		if err != nil {
+			return Image{}, fmt.Errorf("couldn't create copy %s: %w", copyName, err)
+		}
+		err = jpeg.Encode(out, oriented, nil)
+		out.Close()
+		if err != nil {
+			return Image{}, fmt.Errorf("couldn't encode reoriented copy %s: %w", copyName, err)
+		}
+	} else if err := os.WriteFile(copyName, imageBytes, 0750); err != nil {
+		return Image{}, fmt.Errorf("couldn't create copy %s: %w", copyName, err)
 	}
-	ch <- result
+	if cs != nil {
+		cs.add(result.Hash, ext, imageName, widths, outputDir, imagePath, result.DateTime)
+	}
+	if manifest != nil {
+		manifest.Set(entryFor(result, info))
+	}
+	return result, nil
 }
 
-// processImages generates thumbnails, extracts EXIF info, and copies originals to outputDir.
-func processImages(inputDir string, imageNames []string, outputDir string) []Image {
-	n := len(imageNames)
-	result := make([]Image, n)
-	ch := make(chan Image, n)
-	for _, name := range imageNames {
-		go processImage(inputDir, name, outputDir, ch)
+// entryFor builds the cache.Entry recording img's processing results, keyed
+// by the file's current size and mtime.
+func entryFor(img Image, info os.FileInfo) cache.Entry {
+	thumbnails := make([]cache.ThumbnailInfo, len(img.Thumbnails))
+	for i, t := range img.Thumbnails {
+		thumbnails[i] = cache.ThumbnailInfo{Width: t.Width, Height: t.Height}
 	}
-	for i := 0; i < n; i++ {
-		result[i] = <-ch
+	return cache.Entry{
+		Name:         img.Name,
+		Size:         info.Size(),
+		ModTime:      info.ModTime(),
+		SHA256:       img.Hash,
+		EXIFDateTime: img.DateTime,
+		Orientation:  img.Orientation,
+		Lat:          img.Lat,
+		Lon:          img.Lon,
+		HasGPS:       img.HasGPS,
+		Thumbnails:   thumbnails,
+	}
+}
+
+// processImages generates thumbnails, extracts capture times, and copies originals to outputDir,
+// using up to jobs workers concurrently. It returns the successfully processed images (order not
+// guaranteed) along with a joined error for any images that failed, so that a few bad files don't
+// keep the rest of the directory from being processed.
+func processImages(inputDir string, imageNames []string, outputDir string, cs *contentStore, manifest *cache.Manifest, force bool, jobs int, widths []int) ([]Image, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	names := make(chan string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var result []Image
+	var errs []error
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				image, err := processImage(inputDir, name, outputDir, cs, manifest, force, widths)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					result = append(result, image)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range imageNames {
+		names <- name
 	}
-	return result
+	close(names)
+	wg.Wait()
+	return result, errors.Join(errs...)
 }
 
 func dateStringToHeaderText(date string) string {
@@ -247,6 +718,17 @@ func writeHtml(album Album, subAlbums []Album, images []Image, outputDir string)
 			fmt.Fprintf(&buf, `<a href="#%s">%s</a>`, dateStringToId(date), dateStringToHeaderText(date))
 		}
 	}
+	var gpsImages []Image
+	for _, image := range images {
+		if image.HasGPS {
+			gpsImages = append(gpsImages, image)
+		}
+	}
+	if len(gpsImages) > 0 {
+		if err := MapTemplate.Execute(&buf, gpsImages); err != nil {
+			log.Fatalf("Failed to execute map template for album %s: %+v", album.Name, err)
+		}
+	}
 	buf.Write(imageBuf.Bytes())
 	htmlFile := filepath.Join(outputDir, "index.html")
 	if err := os.WriteFile(htmlFile, buf.Bytes(), 0750); err != nil {
@@ -255,21 +737,60 @@ func writeHtml(album Album, subAlbums []Album, images []Image, outputDir string)
 	}
 }
 
+// pruneStale removes manifest entries (and their output files) for images
+// that used to be in this directory but aren't anymore.
+func pruneStale(manifest *cache.Manifest, currentNames []string, outputDir string) {
+	current := make(map[string]bool, len(currentNames))
+	for _, name := range currentNames {
+		current[name] = true
+	}
+	for _, name := range manifest.Names() {
+		if current[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(outputDir, name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Problem removing stale image %s: %+v", name, err)
+		}
+		if entry, ok := manifest.Get(name); ok {
+			for _, t := range entry.Thumbnails {
+				thumbnailName := thumbnailNameFor(name, t.Width)
+				if err := os.Remove(filepath.Join(outputDir, thumbnailName)); err != nil && !os.IsNotExist(err) {
+					log.Printf("Problem removing stale thumbnail %s: %+v", thumbnailName, err)
+				}
+			}
+		}
+		manifest.Delete(name)
+	}
+}
+
 // createAlbum recursively walks intputDir, outputs images + HTML in outputDir.
-// The returned Album has a summary of the work done.
-func createAlbum(inputDir string, outputDir string) Album {
-	result := Album{Name: filepath.Base(inputDir), MinTime: FutureTime, MaxTime: PastTime}
+// cs, if non-nil, is the content-addressed and by-date store to dedupe
+// against. force bypasses the per-directory album.json cache. jobs caps how
+// many images are processed concurrently. widths lists the thumbnail widths
+// to generate for each image. The returned Album has a summary of the work
+// done; the returned error joins failures for any images or subalbums that
+// couldn't be processed, without aborting the rest of the traversal.
+func createAlbum(inputDir string, outputDir string, cs *contentStore, force bool, jobs int, widths []int) (Album, error) {
+	result := Album{
+		Name:    filepath.Base(inputDir),
+		MinTime: FutureTime, MaxTime: PastTime,
+		MinLat: StartMinLat, MaxLat: StartMaxLat,
+		MinLon: StartMinLon, MaxLon: StartMaxLon,
+	}
 	entries, err := os.ReadDir(inputDir)
 	if err != nil {
-		fmt.Printf("Couldn't read dir %s: %+v", inputDir, err)
-		os.Exit(1)
+		return result, fmt.Errorf("couldn't read dir %s: %w", inputDir, err)
 	}
 	var imageNames []string
 	var subAlbums []Album
+	var errs []error
 	for _, entry := range entries {
 		name := entry.Name()
 		if entry.IsDir() {
-			subAlbum := createAlbum(filepath.Join(inputDir, name), filepath.Join(outputDir, name))
+			subAlbum, err := createAlbum(filepath.Join(inputDir, name), filepath.Join(outputDir, name), cs, force, jobs, widths)
+			if err != nil {
+				errs = append(errs, err)
+			}
 			if subAlbum.NumImages > 0 {
 				subAlbums = append(subAlbums, subAlbum)
 				result.NumImages += subAlbum.NumImages
@@ -279,18 +800,50 @@ func createAlbum(inputDir string, outputDir string) Album {
 				if result.MaxTime.Before(subAlbum.MaxTime) {
 					result.MaxTime = subAlbum.MaxTime
 				}
+				if subAlbum.HasGPS {
+					result.HasGPS = true
+					result.expandBounds(subAlbum.MinLat, subAlbum.MinLon)
+					result.expandBounds(subAlbum.MaxLat, subAlbum.MaxLon)
+				}
 			}
 		} else if isImageFile(name) {
 			imageNames = append(imageNames, name)
 		}
 	}
-	if len(imageNames) > 0 {
+	// Even with no images left in inputDir, outputDir may still hold stale
+	// thumbnails/copies and a manifest from a previous run (e.g. every image
+	// in this directory was deleted); load and prune that manifest so
+	// deletions get cleaned up instead of being silently left behind.
+	hadOutput := len(imageNames) > 0
+	if !hadOutput {
+		info, err := os.Stat(outputDir)
+		if err != nil && !os.IsNotExist(err) {
+			return result, fmt.Errorf("couldn't stat output dir %s: %w", outputDir, err)
+		}
+		hadOutput = err == nil && info.IsDir()
+	}
+	if hadOutput {
 		if err := os.MkdirAll(outputDir, 0750); err != nil {
-			fmt.Printf("Couldn't make output dir %s: %+v", outputDir, err)
-			os.Exit(1)
+			return result, fmt.Errorf("couldn't make output dir %s: %w", outputDir, err)
+		}
+	}
+	var manifest *cache.Manifest
+	if hadOutput {
+		manifest, err = cache.Load(outputDir)
+		if err != nil {
+			return result, fmt.Errorf("couldn't load cache for %s: %w", outputDir, err)
+		}
+	}
+	images, err := processImages(inputDir, imageNames, outputDir, cs, manifest, force, jobs, widths)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if manifest != nil {
+		pruneStale(manifest, imageNames, outputDir)
+		if err := manifest.Save(outputDir); err != nil {
+			errs = append(errs, fmt.Errorf("couldn't save cache for %s: %w", outputDir, err))
 		}
 	}
-	images := processImages(inputDir, imageNames, outputDir)
 	for _, image := range images {
 		if image.DateTime.IsZero() {
 			continue
@@ -302,6 +855,13 @@ func createAlbum(inputDir string, outputDir string) Album {
 			result.MaxTime = image.DateTime
 		}
 	}
+	for _, image := range images {
+		if !image.HasGPS {
+			continue
+		}
+		result.HasGPS = true
+		result.expandBounds(image.Lat, image.Lon)
+	}
 	result.NumImages += len(images)
 	slices.SortFunc(images, func(a, b Image) int {
 		if n := a.DateTime.Compare(b.DateTime); n != 0 {
@@ -317,11 +877,39 @@ func createAlbum(inputDir string, outputDir string) Album {
 	})
 
 	writeHtml(result, subAlbums, images, outputDir)
-	return result
+	return result, errors.Join(errs...)
 }
 
 func main() {
 	flag.Parse()
-	album := createAlbum(*inputDirFlag, *outputDirFlag)
+	widths, err := parseThumbnailWidths(*thumbnailWidthsFlag)
+	if err != nil {
+		fmt.Printf("Invalid --thumbnail-widths: %+v\n", err)
+		os.Exit(1)
+	}
+	var cs *contentStore
+	if *contentStoreFlag {
+		if err := store.PrepOutput(*outputDirFlag); err != nil {
+			fmt.Printf("Couldn't prepare content store: %+v", err)
+			os.Exit(1)
+		}
+		manifest, err := store.LoadManifest(*outputDirFlag)
+		if err != nil {
+			fmt.Printf("Couldn't load content store manifest: %+v", err)
+			os.Exit(1)
+		}
+		cs = &contentStore{root: *outputDirFlag, manifest: manifest}
+	}
+	album, err := createAlbum(*inputDirFlag, *outputDirFlag, cs, *forceFlag, *jobsFlag, widths)
+	if cs != nil {
+		if saveErr := cs.manifest.Save(cs.root); saveErr != nil {
+			fmt.Printf("Couldn't save content store manifest: %+v", saveErr)
+			os.Exit(1)
+		}
+	}
 	fmt.Printf("%s\n", album.String())
+	if err != nil {
+		log.Printf("Some images failed to process: %+v", err)
+		os.Exit(1)
+	}
 }
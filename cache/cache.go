@@ -0,0 +1,129 @@
+// Package cache implements the per-album-directory manifest ("album.json")
+// that lets createAlbum skip re-processing images that haven't changed since
+// the last run.
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const fileName = "album.json"
+
+// Entry records what was computed for one image the last time it was
+// processed, so a later run can decide whether to redo that work.
+type Entry struct {
+	Name         string          `json:"name"`
+	Size         int64           `json:"size"`
+	ModTime      time.Time       `json:"mtime"`
+	SHA256       string          `json:"sha256"`
+	EXIFDateTime time.Time       `json:"exif_datetime"`
+	Orientation  int             `json:"orientation,omitempty"`
+	Lat          float64         `json:"lat,omitempty"`
+	Lon          float64         `json:"lon,omitempty"`
+	HasGPS       bool            `json:"has_gps,omitempty"`
+	Thumbnails   []ThumbnailInfo `json:"thumbnails"`
+}
+
+// ThumbnailInfo records the dimensions of one generated thumbnail width.
+type ThumbnailInfo struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Matches reports whether info's size and mtime match this entry exactly,
+// the cheap "fast path" check that lets a run skip reading the file at all.
+func (e Entry) Matches(info os.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime.Equal(info.ModTime())
+}
+
+// Manifest is the set of Entry records for one output directory. It's safe
+// for concurrent use, since processImage is called from the --jobs worker
+// pool with a shared *Manifest.
+type Manifest struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// Load reads the manifest from dir, returning an empty Manifest if it
+// doesn't exist yet.
+func Load(dir string) (*Manifest, error) {
+	m := &Manifest{entries: make(map[string]Entry)}
+	data, err := os.ReadFile(filepath.Join(dir, fileName))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %s under %s: %w", fileName, dir, err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s under %s: %w", fileName, dir, err)
+	}
+	for _, e := range entries {
+		m.entries[e.Name] = e
+	}
+	return m, nil
+}
+
+// Get returns the entry for name, if any.
+func (m *Manifest) Get(name string) (Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[name]
+	return e, ok
+}
+
+// Set records (or replaces) the entry for e.Name.
+func (m *Manifest) Set(e Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[e.Name] = e
+}
+
+// Delete removes the entry for name, if present.
+func (m *Manifest) Delete(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, name)
+}
+
+// Names returns the names of all entries, sorted.
+func (m *Manifest) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.namesLocked()
+}
+
+// namesLocked returns the names of all entries, sorted. Callers must hold m.mu.
+func (m *Manifest) namesLocked() []string {
+	names := make([]string, 0, len(m.entries))
+	for name := range m.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save writes the manifest to dir, overwriting any existing one.
+func (m *Manifest) Save(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := make([]Entry, 0, len(m.entries))
+	for _, name := range m.namesLocked() {
+		entries = append(entries, m.entries[name])
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal %s: %w", fileName, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fileName), data, 0640); err != nil {
+		return fmt.Errorf("couldn't write %s under %s: %w", fileName, dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Package media lets the album generator ingest more than just JPEGs. A
+// Decoder handles one family of file extensions, turning raw file bytes into
+// a decoded image and a best-effort capture timestamp; decoders register
+// themselves in init() so that adding a new format doesn't require touching
+// the album-building code.
+package media
+
+import (
+	"image"
+	"os"
+	"strings"
+	"time"
+)
+
+// Decoder knows how to decode one or more file extensions into a thumbnail-able
+// image and a capture timestamp.
+type Decoder interface {
+	// Extensions returns the lowercase, dot-less file extensions this decoder
+	// handles (e.g. "jpg", "jpeg").
+	Extensions() []string
+	// DecodeImage decodes raw file bytes into an image suitable for
+	// thumbnailing.
+	DecodeImage(data []byte) (image.Image, error)
+	// Timestamp extracts a best-effort capture time for the file. info is the
+	// os.FileInfo for the original file, for decoders that fall back to
+	// filesystem mtime.
+	Timestamp(data []byte, info os.FileInfo) (time.Time, error)
+}
+
+var decoders = make(map[string]Decoder)
+
+// Register associates d with each of its extensions, overwriting any
+// previously registered decoder for that extension. It's meant to be called
+// from package init() functions.
+func Register(d Decoder) {
+	for _, ext := range d.Extensions() {
+		decoders[strings.ToLower(ext)] = d
+	}
+}
+
+// OrientationProvider is implemented by decoders that can report an EXIF-style
+// orientation value (1-8, per the TIFF/EXIF spec) for a file, so that callers
+// can rotate/flip the decoded image before use. Formats without such metadata
+// (PNG, GIF, video posters) simply don't implement it.
+type OrientationProvider interface {
+	Orientation(data []byte) (int, error)
+}
+
+// GPSProvider is implemented by decoders that can report an EXIF GPS
+// position for a file. Formats without such metadata simply don't
+// implement it.
+type GPSProvider interface {
+	LatLong(data []byte) (lat, lon float64, err error)
+}
+
+// ForPath returns the registered Decoder for path's extension, if any.
+func ForPath(path string) (Decoder, bool) {
+	ext := strings.ToLower(strings.TrimPrefix(extOf(path), "."))
+	d, ok := decoders[ext]
+	return d, ok
+}
+
+// IsRegistered reports whether path's extension has a registered decoder.
+func IsRegistered(path string) bool {
+	_, ok := ForPath(path)
+	return ok
+}
+
+func extOf(path string) string {
+	dot := strings.LastIndexByte(path, '.')
+	if dot == -1 {
+		return ""
+	}
+	return path[dot:]
+}
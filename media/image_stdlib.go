@@ -0,0 +1,43 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/png"
+	"os"
+	"time"
+)
+
+func init() {
+	Register(pngDecoder{})
+	Register(gifDecoder{})
+}
+
+// pngDecoder handles PNG files. PNG has no standard capture-time metadata,
+// so Timestamp falls back to the file's mtime.
+type pngDecoder struct{}
+
+func (pngDecoder) Extensions() []string { return []string{"png"} }
+
+func (pngDecoder) DecodeImage(data []byte) (image.Image, error) {
+	return png.Decode(bytes.NewReader(data))
+}
+
+func (pngDecoder) Timestamp(_ []byte, info os.FileInfo) (time.Time, error) {
+	return info.ModTime(), nil
+}
+
+// gifDecoder handles (possibly animated) GIF files, thumbnailing the first
+// frame. Like PNG, it falls back to mtime for the timestamp.
+type gifDecoder struct{}
+
+func (gifDecoder) Extensions() []string { return []string{"gif"} }
+
+func (gifDecoder) DecodeImage(data []byte) (image.Image, error) {
+	return gif.Decode(bytes.NewReader(data))
+}
+
+func (gifDecoder) Timestamp(_ []byte, info os.FileInfo) (time.Time, error) {
+	return info.ModTime(), nil
+}
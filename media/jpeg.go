@@ -0,0 +1,69 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func init() {
+	Register(jpegDecoder{})
+}
+
+type jpegDecoder struct{}
+
+func (jpegDecoder) Extensions() []string {
+	return []string{"jpg", "jpeg"}
+}
+
+func (jpegDecoder) DecodeImage(data []byte) (image.Image, error) {
+	return jpeg.Decode(bytes.NewReader(data))
+}
+
+// Timestamp reads the EXIF DateTime tag. It does not fall back to the
+// filesystem mtime: a missing or unreadable EXIF date is reported as an
+// error so callers can decide how to treat it, matching the tool's
+// historical behavior for JPEGs.
+func (jpegDecoder) Timestamp(data []byte, _ os.FileInfo) (time.Time, error) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return x.DateTime()
+}
+
+// Orientation reads the EXIF Orientation tag (1-8). It returns 1 (identity)
+// alongside the error on any failure to read or parse the tag, so callers
+// can treat a missing/invalid tag the same as an explicit identity value.
+func (jpegDecoder) Orientation(data []byte) (int, error) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 1, err
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1, err
+	}
+	o, err := tag.Int(0)
+	if err != nil {
+		return 1, err
+	}
+	if o < 1 || o > 8 {
+		return 1, fmt.Errorf("orientation tag out of range: %d", o)
+	}
+	return o, nil
+}
+
+// LatLong reads the EXIF GPS latitude/longitude tags.
+func (jpegDecoder) LatLong(data []byte) (float64, float64, error) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return x.LatLong()
+}
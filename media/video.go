@@ -0,0 +1,58 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"time"
+)
+
+func init() {
+	Register(videoDecoder{})
+}
+
+// videoDecoder handles common video containers by shelling out to ffmpeg to
+// grab a poster frame. It has no access to container-level creation-time
+// metadata here, so Timestamp always falls back to the file's mtime.
+type videoDecoder struct{}
+
+func (videoDecoder) Extensions() []string {
+	return []string{"mov", "mp4", "m4v"}
+}
+
+func (videoDecoder) DecodeImage(data []byte) (image.Image, error) {
+	in, err := os.CreateTemp("", "go-photos-video-*")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create temp file for video: %w", err)
+	}
+	defer os.Remove(in.Name())
+	defer in.Close()
+	if _, err := in.Write(data); err != nil {
+		return nil, fmt.Errorf("couldn't write temp video file: %w", err)
+	}
+
+	out, err := os.CreateTemp("", "go-photos-poster-*.jpg")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create temp file for poster frame: %w", err)
+	}
+	defer os.Remove(out.Name())
+	out.Close()
+
+	cmd := exec.Command("ffmpeg", "-y", "-i", in.Name(), "-vframes", "1", out.Name())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed to extract poster frame: %w (%s)", err, output)
+	}
+
+	posterBytes, err := os.ReadFile(out.Name())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read poster frame: %w", err)
+	}
+	return jpeg.Decode(bytes.NewReader(posterBytes))
+}
+
+func (videoDecoder) Timestamp(_ []byte, info os.FileInfo) (time.Time, error) {
+	return info.ModTime(), nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// labelPixel encodes (x, y) into a color so a transformed image's pixels can
+// be traced back to their source coordinates: R and G carry x and y (offset
+// by 1 so (0,0) isn't all-zero), B is a fixed marker.
+func labelPixel(x, y int) color.NRGBA {
+	return color.NRGBA{R: uint8(10*x + 1), G: uint8(10*y + 1), B: 5, A: 255}
+}
+
+// newLabeledImage builds a w x h NRGBA image whose pixels are labelPixel(x, y).
+func newLabeledImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, labelPixel(x, y))
+		}
+	}
+	return img
+}
+
+// rc is a golden pixel, identifying which source pixel it should hold after
+// the transform, e.g. rc{1, 0} means "this pixel should be a copy of source
+// pixel (x=1, y=0)".
+type rc struct{ srcX, srcY int }
+
+func assertGolden(t *testing.T, got image.Image, golden [][]rc) {
+	t.Helper()
+	wantH := len(golden)
+	if wantH == 0 {
+		t.Fatalf("golden has no rows")
+	}
+	wantW := len(golden[0])
+	b := got.Bounds()
+	if b.Dx() != wantW || b.Dy() != wantH {
+		t.Fatalf("got size %dx%d, want %dx%d", b.Dx(), b.Dy(), wantW, wantH)
+	}
+	for y := 0; y < wantH; y++ {
+		for x := 0; x < wantW; x++ {
+			want := labelPixel(golden[y][x].srcX, golden[y][x].srcY)
+			gotR, gotG, gotB, gotA := got.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			wantR, wantG, wantB, wantA := want.RGBA()
+			if gotR != wantR || gotG != wantG || gotB != wantB || gotA != wantA {
+				t.Errorf("pixel (%d,%d) = %+v, want source (%d,%d) = %+v",
+					x, y, got.At(b.Min.X+x, b.Min.Y+y), golden[y][x].srcX, golden[y][x].srcY, want)
+			}
+		}
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// A 3x2 source, asymmetric in both dimensions, so that every orientation
+	// (including diagonal flips and 90-degree rotations) produces a
+	// distinguishable result.
+	const w, h = 3, 2
+	src := newLabeledImage(w, h)
+
+	tests := []struct {
+		name        string
+		orientation int
+		golden      [][]rc
+	}{
+		{
+			name:        "1 identity",
+			orientation: 1,
+			golden: [][]rc{
+				{{0, 0}, {1, 0}, {2, 0}},
+				{{0, 1}, {1, 1}, {2, 1}},
+			},
+		},
+		{
+			name:        "2 flip horizontal",
+			orientation: 2,
+			golden: [][]rc{
+				{{2, 0}, {1, 0}, {0, 0}},
+				{{2, 1}, {1, 1}, {0, 1}},
+			},
+		},
+		{
+			name:        "3 rotate 180",
+			orientation: 3,
+			golden: [][]rc{
+				{{2, 1}, {1, 1}, {0, 1}},
+				{{2, 0}, {1, 0}, {0, 0}},
+			},
+		},
+		{
+			name:        "4 flip vertical",
+			orientation: 4,
+			golden: [][]rc{
+				{{0, 1}, {1, 1}, {2, 1}},
+				{{0, 0}, {1, 0}, {2, 0}},
+			},
+		},
+		{
+			name:        "5 transpose",
+			orientation: 5,
+			golden: [][]rc{
+				{{0, 0}, {0, 1}},
+				{{1, 0}, {1, 1}},
+				{{2, 0}, {2, 1}},
+			},
+		},
+		{
+			name:        "6 rotate 90 CW",
+			orientation: 6,
+			golden: [][]rc{
+				{{0, 1}, {0, 0}},
+				{{1, 1}, {1, 0}},
+				{{2, 1}, {2, 0}},
+			},
+		},
+		{
+			name:        "7 transverse",
+			orientation: 7,
+			golden: [][]rc{
+				{{2, 1}, {2, 0}},
+				{{1, 1}, {1, 0}},
+				{{0, 1}, {0, 0}},
+			},
+		},
+		{
+			name:        "8 rotate 270 CW",
+			orientation: 8,
+			golden: [][]rc{
+				{{2, 0}, {2, 1}},
+				{{1, 0}, {1, 1}},
+				{{0, 0}, {0, 1}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := applyOrientation(src, tc.orientation)
+			assertGolden(t, got, tc.golden)
+		})
+	}
+}
+
+func TestApplyOrientationUnknownValueIsIdentity(t *testing.T) {
+	src := newLabeledImage(3, 2)
+	for _, orientation := range []int{0, -1, 9, 100} {
+		got := applyOrientation(src, orientation)
+		if got != image.Image(src) {
+			t.Errorf("applyOrientation(img, %d) returned a new image, want img unchanged", orientation)
+		}
+	}
+}
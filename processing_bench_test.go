@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// benchCorpusSize approximates the "5k-image corpus" the original request
+// called for; real images that size aren't checked into the repo, so this
+// benchmark synthesizes small JPEGs at run time instead.
+const benchCorpusSize = 5000
+
+// buildBenchCorpus writes n small synthetic JPEGs into dir and returns their
+// names, suitable for feeding to processImages.
+func buildBenchCorpus(b *testing.B, dir string, n int) []string {
+	b.Helper()
+	const size = 32
+	names := make([]string, n)
+	for i := 0; i < n; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, size, size))
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				img.Set(x, y, color.NRGBA{R: uint8(x + i), G: uint8(y + i), B: uint8(i), A: 255})
+			}
+		}
+		name := fmt.Sprintf("bench%05d.jpg", i)
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			b.Fatalf("couldn't create corpus image %s: %v", name, err)
+		}
+		err = jpeg.Encode(f, img, nil)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			b.Fatalf("couldn't write corpus image %s: %v", name, err)
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// BenchmarkProcessImages measures processImages' wall-clock time and
+// approximate peak memory use across a synthetic multi-thousand-image
+// corpus, using the default worker pool size. It reports runtime.MemStats.Sys
+// as a peak-memory proxy since the testing package has no first-class RSS
+// metric; treat it as an order-of-magnitude signal, not an exact figure.
+func BenchmarkProcessImages(b *testing.B) {
+	log.SetOutput(io.Discard) // synthetic images have no EXIF data; silence the per-image warnings
+	defer log.SetOutput(os.Stderr)
+
+	inputDir := b.TempDir()
+	names := buildBenchCorpus(b, inputDir, benchCorpusSize)
+	widths := []int{50, 100}
+	jobs := runtime.NumCPU()
+
+	var peakSys uint64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		outputDir, err := os.MkdirTemp("", "go-photos-bench-out-")
+		if err != nil {
+			b.Fatalf("couldn't create output dir: %v", err)
+		}
+		b.StartTimer()
+
+		if _, err := processImages(inputDir, names, outputDir, nil, nil, true, jobs, widths); err != nil {
+			b.Fatalf("processImages failed: %v", err)
+		}
+
+		b.StopTimer()
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		if ms.Sys > peakSys {
+			peakSys = ms.Sys
+		}
+		os.RemoveAll(outputDir)
+	}
+	b.ReportMetric(float64(peakSys), "peak_sys_bytes")
+}
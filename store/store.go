@@ -0,0 +1,140 @@
+// Package store implements a content-addressed archive layout shared across
+// album runs: a canonical "content/<hash-prefix>/<hash-rest><ext>" tree keyed
+// by file hash, and a parallel "date/YYYY/MM/<unix-nano><ext>" tree for
+// browsing by capture time. Callers hardlink (falling back to a copy) from
+// wherever they've already written a file into these trees instead of
+// re-encoding duplicate images.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	contentDirName  = "content"
+	dateDirName     = "date"
+	manifestName    = "manifest.json"
+	hashPrefixChars = 2
+)
+
+// PrepOutput creates the content/ and date/ directories under root, if they
+// don't already exist.
+func PrepOutput(root string) error {
+	for _, dir := range []string{contentDirName, dateDirName} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0750); err != nil {
+			return fmt.Errorf("couldn't create %s dir under %s: %w", dir, root, err)
+		}
+	}
+	return nil
+}
+
+// ContentPath returns the canonical path for a file with the given hash
+// (e.g. a hex-encoded MD5 or SHA-256 digest) and extension (including the
+// leading dot) under root.
+func ContentPath(root, hash, ext string) string {
+	if len(hash) <= hashPrefixChars {
+		return filepath.Join(root, contentDirName, hash+ext)
+	}
+	return filepath.Join(root, contentDirName, hash[:hashPrefixChars], hash[hashPrefixChars:]+ext)
+}
+
+// DatePath returns the chronological path for a file captured at t, under
+// root, named after a nanosecond-resolution Unix timestamp to keep names
+// unique.
+func DatePath(root string, t time.Time, ext string) string {
+	return filepath.Join(root, dateDirName, fmt.Sprintf("%04d", t.Year()), fmt.Sprintf("%02d", t.Month()),
+		fmt.Sprintf("%d%s", t.UnixNano(), ext))
+}
+
+// LinkOrCopy creates dst as a hardlink to src, creating dst's parent
+// directory as needed. If hardlinking isn't possible (e.g. src and dst are
+// on different filesystems), it falls back to copying the file's contents.
+// It's a no-op if dst already exists.
+func LinkOrCopy(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return fmt.Errorf("couldn't create parent dir for %s: %w", dst, err)
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("couldn't open %s to copy: %w", src, err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("couldn't create %s: %w", dst, err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("couldn't copy %s to %s: %w", src, dst, err)
+	}
+	return nil
+}
+
+// Manifest records which original paths produced each hash seen so far, so
+// that later queries can answer "where did this content come from". It's
+// safe for concurrent use.
+type Manifest struct {
+	mu    sync.Mutex
+	paths map[string][]string
+}
+
+// LoadManifest reads the manifest file under root, returning an empty
+// Manifest if it doesn't exist yet.
+func LoadManifest(root string) (*Manifest, error) {
+	m := &Manifest{paths: make(map[string][]string)}
+	data, err := os.ReadFile(filepath.Join(root, manifestName))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read manifest under %s: %w", root, err)
+	}
+	if err := json.Unmarshal(data, &m.paths); err != nil {
+		return nil, fmt.Errorf("couldn't parse manifest under %s: %w", root, err)
+	}
+	return m, nil
+}
+
+// Save writes the manifest file under root, overwriting any existing one.
+func (m *Manifest) Save(root string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, err := json.MarshalIndent(m.paths, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, manifestName), data, 0640); err != nil {
+		return fmt.Errorf("couldn't write manifest under %s: %w", root, err)
+	}
+	return nil
+}
+
+// Add records that originalPath produced hash, returning true if hash was
+// already present (i.e. this is a duplicate).
+func (m *Manifest) Add(hash, originalPath string) (alreadySeen bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing := m.paths[hash]
+	for _, p := range existing {
+		if p == originalPath {
+			return true
+		}
+	}
+	alreadySeen = len(existing) > 0
+	m.paths[hash] = append(existing, originalPath)
+	sort.Strings(m.paths[hash])
+	return alreadySeen
+}
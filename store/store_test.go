@@ -0,0 +1,138 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestAddReportsCollisions(t *testing.T) {
+	m := &Manifest{paths: make(map[string][]string)}
+
+	if alreadySeen := m.Add("deadbeef", "/photos/a.jpg"); alreadySeen {
+		t.Errorf("Add() on first path = true, want false")
+	}
+	if alreadySeen := m.Add("deadbeef", "/photos/b.jpg"); !alreadySeen {
+		t.Errorf("Add() on second path with same hash = false, want true")
+	}
+	// Re-adding an already-recorded path for the same hash is still a
+	// collision, but shouldn't duplicate the entry.
+	if alreadySeen := m.Add("deadbeef", "/photos/a.jpg"); !alreadySeen {
+		t.Errorf("Add() on repeated path = false, want true")
+	}
+
+	want := []string{"/photos/a.jpg", "/photos/b.jpg"}
+	got := m.paths["deadbeef"]
+	if len(got) != len(want) {
+		t.Fatalf("paths[%q] = %v, want %v", "deadbeef", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("paths[%q][%d] = %q, want %q", "deadbeef", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLinkOrCopyHardlinks(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.jpg")
+	if err := os.WriteFile(src, []byte("hello"), 0640); err != nil {
+		t.Fatalf("WriteFile(src) failed: %v", err)
+	}
+	dst := filepath.Join(dir, "nested", "dst.jpg")
+
+	if err := LinkOrCopy(src, dst); err != nil {
+		t.Fatalf("LinkOrCopy() failed: %v", err)
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("Stat(src) failed: %v", err)
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("Stat(dst) failed: %v", err)
+	}
+	if !os.SameFile(srcInfo, dstInfo) {
+		t.Errorf("LinkOrCopy() on same filesystem didn't hardlink: src and dst are different files")
+	}
+}
+
+func TestLinkOrCopyIsNoopIfDstExists(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.jpg")
+	if err := os.WriteFile(src, []byte("hello"), 0640); err != nil {
+		t.Fatalf("WriteFile(src) failed: %v", err)
+	}
+	dst := filepath.Join(dir, "dst.jpg")
+	if err := os.WriteFile(dst, []byte("already here"), 0640); err != nil {
+		t.Fatalf("WriteFile(dst) failed: %v", err)
+	}
+
+	if err := LinkOrCopy(src, dst); err != nil {
+		t.Fatalf("LinkOrCopy() failed: %v", err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("ReadFile(dst) failed: %v", err)
+	}
+	if string(got) != "already here" {
+		t.Errorf("LinkOrCopy() overwrote existing dst: got %q, want %q", got, "already here")
+	}
+}
+
+// crossFilesystemDir returns a directory known to live on a different
+// filesystem than t.TempDir(), so that os.Link between the two fails with
+// EXDEV, or skips the test if no such directory is available in this
+// environment.
+func crossFilesystemDir(t *testing.T) string {
+	t.Helper()
+	const shm = "/dev/shm"
+	info, err := os.Stat(shm)
+	if err != nil || !info.IsDir() {
+		t.Skip("no /dev/shm available to exercise the cross-filesystem fallback")
+	}
+	dir, err := os.MkdirTemp(shm, "go-photos-store-test-")
+	if err != nil {
+		t.Skipf("couldn't create temp dir under %s: %v", shm, err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestLinkOrCopyFallsBackAcrossFilesystems(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := crossFilesystemDir(t)
+
+	src := filepath.Join(srcDir, "src.jpg")
+	want := "cross-filesystem contents"
+	if err := os.WriteFile(src, []byte(want), 0640); err != nil {
+		t.Fatalf("WriteFile(src) failed: %v", err)
+	}
+	dst := filepath.Join(dstDir, "nested", "dst.jpg")
+
+	if err := LinkOrCopy(src, dst); err != nil {
+		t.Fatalf("LinkOrCopy() failed: %v", err)
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("Stat(src) failed: %v", err)
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("Stat(dst) failed: %v", err)
+	}
+	if os.SameFile(srcInfo, dstInfo) {
+		t.Fatalf("LinkOrCopy() hardlinked across filesystems; expected a copy fallback")
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("ReadFile(dst) failed: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("LinkOrCopy() copy fallback produced %q, want %q", got, want)
+	}
+}